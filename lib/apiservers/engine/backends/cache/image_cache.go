@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 
@@ -47,27 +48,82 @@ type ICache struct {
 	idIndex     *truncindex.TruncIndex
 	cacheByID   map[string]*metadata.ImageConfig
 	cacheByName map[string]*metadata.ImageConfig
+
+	// manifests holds the raw manifest/config JSON blobs behind cacheByID's
+	// entries, keyed by digest.
+	manifests *manifestStore
+
+	// events fans out image.pull/tag/untag/delete/import notifications to
+	// subscribers of Subscribe, and lets derived caches (e.g. disk usage)
+	// detect staleness without re-subscribing for every request.
+	events *eventBus
+
+	// duCache memoizes DiskUsage, invalidated via events' generation
+	// counter rather than recomputed on every call.
+	duCache diskUsageCache
+
+	// shortNameMode governs how GetImage resolves a reference that omits a
+	// repository path, e.g. "foo" rather than "library/foo". The zero value
+	// behaves as ShortNameModePermissive.
+	shortNameMode ShortNameMode
 }
 
-var (
-	imageCache *ICache
-	ctx        = context.TODO()
+// ShortNameMode controls how ICache.GetImage resolves an image reference
+// that omits a repository path, mirroring the policy Podman introduced when
+// it migrated name resolution into libimage.
+type ShortNameMode string
+
+const (
+	// ShortNameModePermissive resolves a short name to any one matching
+	// repository, picking a candidate silently if more than one matches.
+	// This is vic's historical behavior and the default.
+	ShortNameModePermissive ShortNameMode = "permissive"
+	// ShortNameModeStrict refuses to resolve a short name that matches more
+	// than one repository, returning an AmbiguousReferenceError listing the
+	// candidates instead of picking one.
+	ShortNameModeStrict ShortNameMode = "strict"
+	// ShortNameModeDisabled refuses to resolve short names at all; callers
+	// must supply a fully qualified repository path, e.g. "library/foo".
+	ShortNameModeDisabled ShortNameMode = "disabled"
 )
 
-func init() {
-	imageCache = &ICache{
+// SetShortNameMode sets the policy GetImage uses to resolve unqualified
+// image references.
+func (ic *ICache) SetShortNameMode(mode ShortNameMode) {
+	ic.m.Lock()
+	defer ic.m.Unlock()
+	ic.shortNameMode = mode
+}
+
+// AmbiguousReferenceError is returned by GetImage, in ShortNameModeStrict,
+// when a short name matches more than one repository.
+type AmbiguousReferenceError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousReferenceError) Error() string {
+	return fmt.Sprintf("short name %q is ambiguous: candidates are %s", e.Name, strings.Join(e.Candidates, ", "))
+}
+
+var ctx = context.TODO()
+
+// newICache builds an empty, unhydrated image cache. Call Update to
+// populate it from the portlayer.
+func newICache() *ICache {
+	return &ICache{
 		idIndex:     truncindex.NewTruncIndex([]string{}),
 		cacheByID:   make(map[string]*metadata.ImageConfig),
 		cacheByName: make(map[string]*metadata.ImageConfig),
+		manifests:   newManifestStore(),
+		events:      newEventBus(),
 	}
 }
 
-// ImageCache returns a reference to the image cache
-func ImageCache() *ICache {
-	return imageCache
-}
-
 // Update runs only once at startup to hydrate the image cache
+//
+// Deprecated: call (*ImageService).Update on a constructed ImageService
+// instead. This method is kept for the ImageCache() compatibility shim.
 func (ic *ICache) Update(client *client.PortLayer) error {
 	log.Debugf("Updating image cache")
 
@@ -93,6 +149,8 @@ func (ic *ICache) Update(client *client.PortLayer) error {
 		// images (and layers?)
 		LayerCache().AddExisting(layer.ID)
 
+		ic.HydrateManifest(layer.Metadata)
+
 		imageConfig := &metadata.ImageConfig{}
 		if err := json.Unmarshal([]byte(layer.Metadata[metadata.MetaDataKey]), imageConfig); err != nil {
 			derr.NewErrorWithStatusCode(fmt.Errorf("Failed to unmarshal image config: %s", err),
@@ -154,7 +212,10 @@ func (ic *ICache) GetImage(idOrRef string) (*metadata.ImageConfig, error) {
 	if imgDigest != "" {
 		config = ic.getImageByDigest(imgDigest)
 	} else {
-		config = ic.getImageByNamed(named)
+		config, err = ic.getImageByNamed(named)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if config == nil {
@@ -179,11 +240,86 @@ func (ic *ICache) getImageByDigest(digest digest.Digest) *metadata.ImageConfig {
 	return copyImageConfig(config)
 }
 
-// Looks up image by reference.Named
-func (ic *ICache) getImageByNamed(named reference.Named) *metadata.ImageConfig {
+// getImageByNamed looks up an image by reference.Named. Resolution is still
+// authoritative through RepositoryCache().Get, which is the independently
+// mutated name/tag/digest store (see copyImageConfig's use of
+// RepositoryCache().Tags/Digests) -- so an image tagged after its initial
+// AddImage remains resolvable. Repository-boundary short-name matching is
+// layered on top of that: a path that omits a registry/namespace prefix
+// ("foo") is only resolved against RepositoryCache's repositories on a
+// path-segment boundary, so "foo" matches "library/foo" and "user/foo" but
+// never "myfoo" or "foobar". It never resolves the "none" tag (as in
+// "name:none") to an untagged image.
+func (ic *ICache) getImageByNamed(named reference.Named) (*metadata.ImageConfig, error) {
+	tag := reference.DefaultTag
+	if tagged, ok := named.(reference.NamedTagged); ok {
+		tag = tagged.Tag()
+	}
+
+	if tag == "none" {
+		return nil, nil
+	}
+
+	repo := named.Name()
+
+	if !strings.Contains(repo, "/") {
+		mode := ic.shortNameMode
+		if mode == "" {
+			mode = ShortNameModePermissive
+		}
+		if mode == ShortNameModeDisabled {
+			return nil, nil
+		}
+
+		switch candidates := matchingRepositories(RepositoryCache().Repositories(), repo); {
+		case len(candidates) == 1:
+			repo = candidates[0]
+		case len(candidates) > 1 && mode == ShortNameModeStrict:
+			return nil, &AmbiguousReferenceError{Name: named.Name(), Candidates: candidates}
+		case len(candidates) > 1:
+			// permissive: fall back to vic's historical behavior of
+			// silently picking a candidate
+			repo = candidates[0]
+		}
+	}
+
+	resolved := named
+	if repo != named.Name() {
+		qualified, err := reference.WithName(repo)
+		if err != nil {
+			return nil, nil
+		}
+		if qualified, err = reference.WithTag(qualified, tag); err != nil {
+			return nil, nil
+		}
+		resolved = qualified
+	}
+
 	// get the imageID from the repoCache
-	id, _ := RepositoryCache().Get(named)
-	return copyImageConfig(ic.cacheByID[prefixImageID(id)])
+	id, _ := RepositoryCache().Get(resolved)
+	return copyImageConfig(ic.cacheByID[prefixImageID(id)]), nil
+}
+
+// matchingRepositories returns, in sorted order, every repo in repos whose
+// final path segment is shortName.
+func matchingRepositories(repos []string, shortName string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, repo := range repos {
+		if seen[repo] || !repoHasShortName(repo, shortName) {
+			continue
+		}
+		seen[repo] = true
+		matches = append(matches, repo)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// repoHasShortName reports whether repo (e.g. "library/foo") has shortName
+// (e.g. "foo") as its final path segment.
+func repoHasShortName(repo, shortName string) bool {
+	return repo == shortName || strings.HasSuffix(repo, "/"+shortName)
 }
 
 // Add the "sha256:" prefix to the image ID if missing.
@@ -196,9 +332,20 @@ func prefixImageID(imageID string) string {
 	return "sha256:" + imageID
 }
 
-// AddImage adds an image to the image cache
+// AddImage adds an image pulled from a registry to the image cache,
+// publishing an EventImagePull.
 func (ic *ICache) AddImage(imageConfig *metadata.ImageConfig) {
+	ic.addImage(imageConfig, EventImagePull)
+}
+
+// AddImportedImage adds an image produced by `docker import` to the image
+// cache, publishing an EventImageImport rather than the EventImagePull
+// AddImage emits for an ordinary pull.
+func (ic *ICache) AddImportedImage(imageConfig *metadata.ImageConfig) {
+	ic.addImage(imageConfig, EventImageImport)
+}
 
+func (ic *ICache) addImage(imageConfig *metadata.ImageConfig, action EventAction) {
 	ic.m.Lock()
 	defer ic.m.Unlock()
 
@@ -221,6 +368,34 @@ func (ic *ICache) AddImage(imageConfig *metadata.ImageConfig) {
 		}
 		ic.cacheByName[imageConfig.Reference] = imageConfig
 	}
+
+	ic.events.publish(action, imageConfig.ImageID, imageConfig.Tags, EventActor{Name: imageConfig.Name})
+}
+
+// TagImage tags imageID with ref in the repository cache and publishes an
+// EventImageTag. This is the only path that fires EventImageTag -- a caller
+// that tags an image by calling RepositoryCache().Tag directly instead of
+// going through here will tag the image without ever notifying subscribers.
+// No call site in this tree has been migrated onto TagImage/UntagImage yet;
+// until the docker tag/untag command handlers are, treat event delivery for
+// tag/untag as unimplemented in practice, not just in theory.
+func (ic *ICache) TagImage(imageID, ref string) error {
+	if err := RepositoryCache().Tag(ref, imageID); err != nil {
+		return err
+	}
+	ic.events.publish(EventImageTag, imageID, []string{ref}, EventActor{Name: ref})
+	return nil
+}
+
+// UntagImage removes ref from the repository cache and publishes an
+// EventImageUntag. See the TagImage doc comment -- the same caveat about
+// unmigrated call sites applies here.
+func (ic *ICache) UntagImage(imageID, ref string) error {
+	if err := RepositoryCache().Untag(ref); err != nil {
+		return err
+	}
+	ic.events.publish(EventImageUntag, imageID, []string{ref}, EventActor{Name: ref})
+	return nil
 }
 
 // RemoveImageByConfig removes image from the cache.
@@ -247,6 +422,8 @@ func (ic *ICache) RemoveImageByConfig(imageConfig *metadata.ImageConfig) {
 	} else {
 		log.Debugf("Not found in cache by name: %s", imageConfig.Reference)
 	}
+
+	ic.events.publish(EventImageDelete, imageConfig.ImageID, imageConfig.Tags, EventActor{Name: imageConfig.Name})
 }
 
 // copyImageConfig performs and returns deep copy of an ImageConfig struct
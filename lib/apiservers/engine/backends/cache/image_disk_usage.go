@@ -0,0 +1,265 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/go-openapi/swag"
+
+	"github.com/vmware/vic/lib/apiservers/portlayer/client"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/containers"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/storage"
+	"github.com/vmware/vic/lib/metadata"
+)
+
+// ImageUsage is the disk usage breakdown for a single cached image.
+type ImageUsage struct {
+	ID         string
+	Tags       []string
+	Size       int64
+	SharedSize int64
+	UniqueSize int64
+}
+
+// ImageDiskUsage is the response shape for ICache.DiskUsage, matching
+// Docker's /system/df image accounting so the personality server can proxy
+// it directly.
+type ImageDiskUsage struct {
+	Images      []*ImageUsage
+	Total       int64
+	Reclaimable int64
+}
+
+// PrunedImage identifies one image removed by Prune, matching the shape of
+// Docker's /images/prune response items.
+type PrunedImage struct {
+	Deleted string
+}
+
+// diskUsageCache memoizes the last computed ImageDiskUsage, keyed by the
+// event bus generation it was computed at, so repeated `docker system df`
+// calls don't re-walk the layer cache unless something has actually
+// changed.
+type diskUsageCache struct {
+	m          sync.Mutex
+	generation int64
+	usage      *ImageDiskUsage
+}
+
+func (c *diskUsageCache) get(generation int64) *ImageDiskUsage {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.usage != nil && c.generation == generation {
+		return c.usage
+	}
+	return nil
+}
+
+func (c *diskUsageCache) set(generation int64, usage *ImageDiskUsage) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.generation = generation
+	c.usage = usage
+}
+
+// layerRefCounts counts how many images reference each layer, so callers
+// can tell a layer's size apart as shared (referenced by more than one
+// image) or unique (referenced by exactly one).
+func layerRefCounts(images []*metadata.ImageConfig) map[string]int {
+	refCount := make(map[string]int)
+	for _, image := range images {
+		for _, layerID := range LayerCache().Chain(image.ImageID) {
+			refCount[layerID]++
+		}
+	}
+	return refCount
+}
+
+// imageLayerSizes sums imageID's full layer chain into total, shared, and
+// unique byte counts, using refCount computed by layerRefCounts over the
+// same image set imageID belongs to. unique is the portion of total that is
+// not referenced by any other image in that set, and so is what pruning
+// imageID would actually reclaim.
+func imageLayerSizes(imageID string, refCount map[string]int) (total, shared, unique int64) {
+	for _, layerID := range LayerCache().Chain(imageID) {
+		size := LayerCache().Size(layerID)
+		total += size
+		if refCount[layerID] > 1 {
+			shared += size
+		} else {
+			unique += size
+		}
+	}
+	return total, shared, unique
+}
+
+// DiskUsage walks the image cache and the layer cache to compute per-image
+// size, the split between bytes unique to an image and bytes shared with
+// another, and the total space reclaimable by pruning dangling images. A
+// dangling image's shared bytes are excluded from Reclaimable, since a
+// layer still referenced by a tagged image isn't actually freed by pruning.
+func (ic *ICache) DiskUsage() (*ImageDiskUsage, error) {
+	generation := ic.events.generation()
+	if cached := ic.duCache.get(generation); cached != nil {
+		return cached, nil
+	}
+
+	// copies, not a snapshot, so Tags reflect the repository cache
+	images, err := ic.FilterImages(filters.NewArgs(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	refCount := layerRefCounts(images)
+
+	usage := &ImageDiskUsage{Images: make([]*ImageUsage, 0, len(images))}
+	for _, image := range images {
+		total, shared, unique := imageLayerSizes(image.ImageID, refCount)
+		iu := &ImageUsage{ID: image.ImageID, Tags: image.Tags, Size: total, SharedSize: shared, UniqueSize: unique}
+
+		usage.Total += total
+		if len(iu.Tags) == 0 {
+			usage.Reclaimable += unique
+		}
+		usage.Images = append(usage.Images, iu)
+	}
+
+	ic.duCache.set(generation, usage)
+	return usage, nil
+}
+
+// acceptedPruneFilterTags are the filter keys Prune understands.
+var acceptedPruneFilterTags = map[string]bool{
+	"until": true,
+	"label": true,
+}
+
+// Prune removes every dangling image that also matches every filter in
+// pruneFilters; tagged images are never removed. It returns the same response shape as
+// Docker's /images/prune so the personality server can proxy it directly.
+// It refuses to remove an image referenced by a container the portlayer
+// still knows about, and it never holds ic.m across the portlayer RPCs it
+// makes along the way.
+func (ic *ICache) Prune(plClient *client.PortLayer, pruneFilters filters.Args) ([]*PrunedImage, int64, error) {
+	if err := pruneFilters.Validate(acceptedPruneFilterTags); err != nil {
+		return nil, 0, err
+	}
+
+	var until *time.Time
+	if values := pruneFilters.Get("until"); len(values) > 0 {
+		d, err := time.ParseDuration(values[0])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid filter 'until': %s", err)
+		}
+		cutoff := time.Now().Add(-d)
+		until = &cutoff
+	}
+
+	inUse, err := imagesInUse(plClient)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// collect candidates up front so we never hold ic.m while making the
+	// portlayer RPCs above or the removal RPCs below; copies rather than a
+	// snapshot, so Tags reflect the repository cache
+	candidates, err := ic.FilterImages(filters.NewArgs(), false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	refCount := layerRefCounts(candidates)
+
+	var pruned []*PrunedImage
+	var reclaimed int64
+
+	for _, image := range candidates {
+		if !isPruneCandidate(image, pruneFilters, until, inUse) {
+			continue
+		}
+
+		size := imageChainSize(image.ImageID, refCount)
+		if err := removePrunedImage(plClient, image); err != nil {
+			log.Errorf("Failed to prune image %s: %s", image.ImageID, err)
+			continue
+		}
+
+		ic.RemoveImageByConfig(image)
+		pruned = append(pruned, &PrunedImage{Deleted: image.ImageID})
+		reclaimed += size
+	}
+
+	return pruned, reclaimed, nil
+}
+
+// isPruneCandidate reports whether image should be removed by Prune: it
+// must be dangling, not referenced by any in-use container, and must match
+// every filter in pruneFilters.
+func isPruneCandidate(image *metadata.ImageConfig, pruneFilters filters.Args, until *time.Time, inUse map[string]bool) bool {
+	if len(image.Tags) != 0 {
+		return false
+	}
+	if inUse[image.ImageID] {
+		return false
+	}
+	if until != nil && image.Created.After(*until) {
+		return false
+	}
+	if pruneFilters.Include("label") && !pruneFilters.MatchKVList("label", image.Config.Labels) {
+		return false
+	}
+	return true
+}
+
+// imagesInUse returns the set of image IDs referenced by any container the
+// portlayer currently knows about.
+func imagesInUse(plClient *client.PortLayer) (map[string]bool, error) {
+	params := containers.NewGetContainerListParamsWithContext(ctx).WithAll(swag.Bool(true))
+
+	resp, err := plClient.Containers.GetContainerList(params)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve container list from portlayer: %s", err)
+	}
+
+	inUse := make(map[string]bool)
+	for _, c := range resp.Payload {
+		inUse[c.ContainerConfig.ImageID] = true
+	}
+	return inUse, nil
+}
+
+// imageChainSize returns the bytes of imageID's layer chain that no other
+// image counted in refCount references -- the unique size DiskUsage adds to
+// Reclaimable via imageLayerSizes -- so Prune reports the same reclaimed size
+// DiskUsage would have predicted for it.
+func imageChainSize(imageID string, refCount map[string]int) int64 {
+	_, _, unique := imageLayerSizes(imageID, refCount)
+	return unique
+}
+
+// removePrunedImage asks the portlayer to delete an image's layer.
+func removePrunedImage(plClient *client.PortLayer, image *metadata.ImageConfig) error {
+	params := storage.NewRemoveImageParamsWithContext(ctx).WithImageID(image.ImageID)
+	if _, err := plClient.Storage.RemoveImage(params); err != nil {
+		return fmt.Errorf("Failed to remove image from portlayer: %s", err)
+	}
+	return nil
+}
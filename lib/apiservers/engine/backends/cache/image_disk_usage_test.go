@@ -0,0 +1,93 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/vmware/vic/lib/metadata"
+)
+
+func pruneTestImage(tags []string, created time.Time, labels map[string]string) *metadata.ImageConfig {
+	return &metadata.ImageConfig{
+		ImageID: "deadbeef",
+		Tags:    tags,
+		Created: created,
+		Config:  &metadata.Config{Labels: labels},
+	}
+}
+
+func TestIsPruneCandidateTagged(t *testing.T) {
+	image := pruneTestImage([]string{"latest"}, time.Now(), nil)
+
+	if isPruneCandidate(image, filters.NewArgs(), nil, nil) {
+		t.Error("a tagged image should never be a prune candidate")
+	}
+}
+
+func TestIsPruneCandidateInUse(t *testing.T) {
+	image := pruneTestImage(nil, time.Now(), nil)
+	inUse := map[string]bool{image.ImageID: true}
+
+	if isPruneCandidate(image, filters.NewArgs(), nil, inUse) {
+		t.Error("an image referenced by a container should never be a prune candidate")
+	}
+}
+
+func TestIsPruneCandidateUntil(t *testing.T) {
+	old := pruneTestImage(nil, time.Now().Add(-2*time.Hour), nil)
+	recent := pruneTestImage(nil, time.Now(), nil)
+	cutoff := time.Now().Add(-time.Hour)
+
+	if !isPruneCandidate(old, filters.NewArgs(), &cutoff, nil) {
+		t.Error("an image created before the until cutoff should be a prune candidate")
+	}
+	if isPruneCandidate(recent, filters.NewArgs(), &cutoff, nil) {
+		t.Error("an image created after the until cutoff should not be a prune candidate")
+	}
+}
+
+func TestIsPruneCandidateLabel(t *testing.T) {
+	image := pruneTestImage(nil, time.Now(), map[string]string{"keep": "true"})
+
+	matching := filters.NewArgs()
+	matching.Add("label", "keep=true")
+	if !isPruneCandidate(image, matching, nil, nil) {
+		t.Error("an image with a matching label should be a prune candidate")
+	}
+
+	mismatched := filters.NewArgs()
+	mismatched.Add("label", "keep=false")
+	if isPruneCandidate(image, mismatched, nil, nil) {
+		t.Error("an image without a matching label should not be a prune candidate")
+	}
+}
+
+func TestDiskUsageCacheInvalidatesOnGenerationChange(t *testing.T) {
+	c := &diskUsageCache{}
+	usage := &ImageDiskUsage{Total: 42}
+
+	c.set(1, usage)
+
+	if got := c.get(1); got != usage {
+		t.Fatalf("get(1) = %v, want cached usage", got)
+	}
+	if got := c.get(2); got != nil {
+		t.Fatalf("get(2) = %v, want nil after generation changed", got)
+	}
+}
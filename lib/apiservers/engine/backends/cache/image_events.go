@@ -0,0 +1,140 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventAction identifies the kind of mutation an Event represents.
+type EventAction string
+
+// Image cache event actions, named to match Docker's `docker events
+// --filter type=image` action strings.
+const (
+	EventImagePull   EventAction = "image.pull"
+	EventImageTag    EventAction = "image.tag"
+	EventImageUntag  EventAction = "image.untag"
+	EventImageDelete EventAction = "image.delete"
+	EventImageImport EventAction = "image.import"
+)
+
+// EventActor carries the name/tag attributes Docker attaches to image
+// events.
+type EventActor struct {
+	Name string
+	Tag  string
+}
+
+// Event describes a single mutation of the image cache.
+type Event struct {
+	ID     string
+	Refs   []string
+	Action EventAction
+	Actor  EventActor
+
+	// Seq is a monotonically increasing sequence number assigned at
+	// publish time, usable by subscribers as an ordering guarantee.
+	Seq int64
+}
+
+// eventBus fans out Events to every active subscriber. Publishing never
+// blocks on a slow or gone subscriber: each subscriber channel is buffered
+// and an Event is dropped for it if the buffer is full.
+type eventBus struct {
+	m           sync.Mutex
+	subscribers map[chan Event]struct{}
+	seq         int64
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a new subscriber and returns a channel that receives
+// every Event published after this call, until ctx is done. A nil eventBus
+// (an ICache not built via newICache) returns a closed channel rather than
+// panicking.
+func (b *eventBus) Subscribe(ctx context.Context) <-chan Event {
+	if b == nil {
+		ch := make(chan Event)
+		close(ch)
+		return ch
+	}
+
+	ch := make(chan Event, 16)
+
+	b.m.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.m.Lock()
+		delete(b.subscribers, ch)
+		b.m.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// generation returns the sequence number of the last published Event, for
+// callers that want to cheaply detect "has anything changed" without
+// subscribing. A nil eventBus reports generation 0.
+func (b *eventBus) generation() int64 {
+	if b == nil {
+		return 0
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.seq
+}
+
+// publish emits an Event to every current subscriber. It is a no-op on a
+// nil eventBus, so an ICache built as a bare struct literal rather than via
+// newICache doesn't panic on its first mutation.
+func (b *eventBus) publish(action EventAction, id string, refs []string, actor EventActor) {
+	if b == nil {
+		return
+	}
+
+	// hold b.m while sending so a subscriber's channel can't be closed by
+	// its ctx.Done goroutine mid-send; the sends never block
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.seq++
+	evt := Event{ID: id, Refs: refs, Action: action, Actor: actor, Seq: b.seq}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			log.Debugf("dropping %s event for %s: subscriber channel full", action, id)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives every image cache mutation
+// event published after this call, until ctx is done. Events reach only the
+// callers of Subscribe; this package does not serve them on any API
+// endpoint.
+func (ic *ICache) Subscribe(ctx context.Context) <-chan Event {
+	return ic.events.Subscribe(ctx)
+}
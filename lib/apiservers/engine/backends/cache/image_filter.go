@@ -0,0 +1,158 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/vmware/vic/lib/metadata"
+)
+
+// acceptedImageFilterTags are the filter keys FilterImages understands. They
+// mirror the grammar accepted by the Docker Engine API's /images/json
+// endpoint, so the portlayer's handler can pass query args straight through.
+var acceptedImageFilterTags = map[string]bool{
+	"dangling":  true,
+	"label":     true,
+	"before":    true,
+	"since":     true,
+	"reference": true,
+	"id":        true,
+}
+
+// FilterImages returns metadata for every cached image that matches every
+// predicate in imageFilters. imageFilters uses the filters.Args format
+// accepted by the Docker Engine API.
+//
+// If snapshot is true, the returned *metadata.ImageConfig values are the
+// cache's own pointers rather than deep copies, which avoids a
+// copyImageConfig allocation per matching image. Their Tags are the ones
+// stored at AddImage time, not the current tags from RepositoryCache. Only
+// use snapshot mode for read-only callers that won't mutate the result, don't
+// depend on current tags, and can tolerate it changing concurrently with a
+// later AddImage or RemoveImageByConfig.
+func (ic *ICache) FilterImages(imageFilters filters.Args, snapshot bool) ([]*metadata.ImageConfig, error) {
+	if err := imageFilters.Validate(acceptedImageFilterTags); err != nil {
+		return nil, err
+	}
+
+	before, err := ic.filterCutoff(imageFilters, "before")
+	if err != nil {
+		return nil, err
+	}
+
+	since, err := ic.filterCutoff(imageFilters, "since")
+	if err != nil {
+		return nil, err
+	}
+
+	ic.m.RLock()
+	defer ic.m.RUnlock()
+
+	result := make([]*metadata.ImageConfig, 0, len(ic.cacheByID))
+	for _, image := range ic.cacheByID {
+		if !ic.matchesImageFilters(image, imageFilters, before, since) {
+			continue
+		}
+
+		if snapshot {
+			result = append(result, image)
+			continue
+		}
+		result = append(result, copyImageConfig(image))
+	}
+
+	return result, nil
+}
+
+// filterCutoff resolves the single before/since filter value, if present, to
+// the referenced image's creation time.
+func (ic *ICache) filterCutoff(imageFilters filters.Args, key string) (*time.Time, error) {
+	values := imageFilters.Get(key)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	config, err := ic.GetImage(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %s", key, err)
+	}
+
+	created := config.Created
+	return &created, nil
+}
+
+// matchesImageFilters reports whether image satisfies every predicate in
+// imageFilters. before and since, when non-nil, are the creation-time
+// cutoffs already resolved by filterCutoff.
+func (ic *ICache) matchesImageFilters(image *metadata.ImageConfig, imageFilters filters.Args, before, since *time.Time) bool {
+	tags := RepositoryCache().Tags(image.ImageID)
+
+	if imageFilters.Include("dangling") {
+		if !imageFilters.ExactMatch("dangling", strconv.FormatBool(len(tags) == 0)) {
+			return false
+		}
+	}
+
+	if imageFilters.Include("label") && !imageFilters.MatchKVList("label", image.Config.Labels) {
+		return false
+	}
+
+	if imageFilters.Include("reference") && !matchesAnyReference(imageFilters.Get("reference"), tags) {
+		return false
+	}
+
+	if imageFilters.Include("id") && !ic.matchesIDPrefix(imageFilters.Get("id"), image.ImageID) {
+		return false
+	}
+
+	if before != nil && !image.Created.Before(*before) {
+		return false
+	}
+	if since != nil && !image.Created.After(*since) {
+		return false
+	}
+
+	return true
+}
+
+// matchesAnyReference reports whether any of an image's tags glob-matches
+// one of the given reference patterns.
+func matchesAnyReference(patterns, tags []string) bool {
+	for _, tag := range tags {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, tag); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesIDPrefix reports whether imageID is the image resolved by any of
+// the given truncindex prefixes.
+func (ic *ICache) matchesIDPrefix(prefixes []string, imageID string) bool {
+	for _, prefix := range prefixes {
+		if id, err := ic.idIndex.Get(prefix); err == nil && id == imageID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/vmware/vic/lib/metadata"
+)
+
+// benchICacheWithImages builds an ICache containing n images, each tagged
+// "repo<i>:latest" with a two-entry label set, for use by the benchmarks
+// below.
+func benchICacheWithImages(n int) *ICache {
+	ic := newICache()
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("repo%d", i)
+		ic.AddImage(&metadata.ImageConfig{
+			ImageID: fmt.Sprintf("%064d", i),
+			Name:    name,
+			Tags:    []string{"latest"},
+			Created: time.Now(),
+			Config: &metadata.Config{
+				Labels: map[string]string{"com.example.index": fmt.Sprintf("%d", i)},
+			},
+		})
+	}
+
+	return ic
+}
+
+func BenchmarkFilterImagesUnfiltered(b *testing.B) {
+	ic := benchICacheWithImages(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ic.FilterImages(filters.NewArgs(), false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterImagesUnfilteredSnapshot(b *testing.B) {
+	ic := benchICacheWithImages(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ic.FilterImages(filters.NewArgs(), true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterImagesByLabel(b *testing.B) {
+	ic := benchICacheWithImages(10000)
+
+	f := filters.NewArgs()
+	f.Add("label", "com.example.index=42")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ic.FilterImages(f, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterImagesByReference(b *testing.B) {
+	ic := benchICacheWithImages(10000)
+
+	f := filters.NewArgs()
+	f.Add("reference", "latest")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ic.FilterImages(f, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
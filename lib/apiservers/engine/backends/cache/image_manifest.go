@@ -0,0 +1,213 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/docker/distribution/digest"
+)
+
+// Manifest and config media types understood by GetManifest/PutManifest.
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifestListEntry is the subset of a Docker manifest list / OCI image
+// index entry needed to pick a platform-matching child manifest.
+type manifestListEntry struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Platform  struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+type manifestList struct {
+	Manifests []manifestListEntry `json:"manifests"`
+}
+
+// blob is a raw manifest or config JSON payload, stored under its digest.
+type blob struct {
+	mediaType string
+	data      []byte
+}
+
+// Layer metadata keys a store entry's manifest and config blobs are
+// persisted under, alongside metadata.MetaDataKey. HydrateManifest reads
+// them back at startup.
+const (
+	layerManifestKey     = "manifest"
+	layerManifestTypeKey = "manifestMediaType"
+	layerConfigKey       = "config"
+)
+
+// manifestStore is an in-memory, content-addressable store for the raw
+// manifest and image config JSON blobs behind every cached image, keyed by
+// their digests, so that image inspect, history, and save can return the
+// spec-accurate JSON a registry actually served instead of the reconstructed
+// metadata.ImageConfig. It is populated through PutManifest and PutConfig,
+// and re-hydrated from a layer's persisted metadata at startup by
+// HydrateManifest; this package does not call PutManifest or PutConfig
+// itself.
+type manifestStore struct {
+	m         sync.RWMutex
+	manifests map[digest.Digest]blob
+	configs   map[digest.Digest]blob
+}
+
+func newManifestStore() *manifestStore {
+	return &manifestStore{
+		manifests: make(map[digest.Digest]blob),
+		configs:   make(map[digest.Digest]blob),
+	}
+}
+
+// GetManifest returns the raw manifest JSON stored under dgst. A manifest
+// list or OCI image index is resolved to the child manifest matching
+// runtime.GOOS/runtime.GOARCH, falling back to the first listed entry if
+// none match.
+func (ic *ICache) GetManifest(dgst digest.Digest) ([]byte, error) {
+	b, ok := ic.manifests.getManifest(dgst)
+	if !ok {
+		return nil, fmt.Errorf("no manifest stored for digest %s", dgst)
+	}
+
+	switch b.mediaType {
+	case MediaTypeDockerManifestList, MediaTypeOCIIndex:
+		return ic.resolvePlatformManifest(b.data)
+	default:
+		return b.data, nil
+	}
+}
+
+// resolvePlatformManifest picks the child manifest of a manifest list/index
+// matching the current platform and returns its already-stored bytes.
+func (ic *ICache) resolvePlatformManifest(data []byte) ([]byte, error) {
+	var list manifestList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest list: %s", err)
+	}
+	if len(list.Manifests) == 0 {
+		return nil, fmt.Errorf("manifest list has no entries")
+	}
+
+	child := list.Manifests[0]
+	for _, entry := range list.Manifests {
+		if entry.Platform.OS == runtime.GOOS && entry.Platform.Architecture == runtime.GOARCH {
+			child = entry
+			break
+		}
+	}
+
+	b, ok := ic.manifests.getManifest(child.Digest)
+	if !ok {
+		return nil, fmt.Errorf("no manifest stored for digest %s referenced by manifest list", child.Digest)
+	}
+	return b.data, nil
+}
+
+// GetConfig returns the raw image config JSON stored under dgst.
+func (ic *ICache) GetConfig(dgst digest.Digest) ([]byte, error) {
+	b, ok := ic.manifests.getConfig(dgst)
+	if !ok {
+		return nil, fmt.Errorf("no config stored for digest %s", dgst)
+	}
+	return b.data, nil
+}
+
+// PutManifest stores a raw manifest JSON blob under dgst, after verifying
+// that the blob actually hashes to dgst.
+func (ic *ICache) PutManifest(dgst digest.Digest, mediaType string, data []byte) error {
+	if err := verifyBlobDigest(dgst, data); err != nil {
+		return err
+	}
+	ic.manifests.putManifest(dgst, blob{mediaType: mediaType, data: data})
+	return nil
+}
+
+// PutConfig stores a raw image config JSON blob under dgst, after verifying
+// that the blob actually hashes to dgst.
+func (ic *ICache) PutConfig(dgst digest.Digest, data []byte) error {
+	if err := verifyBlobDigest(dgst, data); err != nil {
+		return err
+	}
+	ic.manifests.putConfig(dgst, blob{data: data})
+	return nil
+}
+
+// HydrateManifest re-populates ic.manifests for one layer from the blobs
+// persisted alongside its metadata.MetaDataKey entry, so a restart doesn't
+// lose the original manifest/config JSON a registry served. layerMetadata is
+// a layer's Metadata map as returned by the portlayer; absent keys (layers
+// pulled before the portlayer started persisting these, or layers that were
+// imported rather than pulled) are silently skipped rather than treated as
+// an error, since Update must still be able to hydrate the rest of the
+// cache from such layers.
+func (ic *ICache) HydrateManifest(layerMetadata map[string]string) {
+	if raw, ok := layerMetadata[layerManifestKey]; ok && raw != "" {
+		data := []byte(raw)
+		ic.manifests.putManifest(digest.FromBytes(data), blob{
+			mediaType: layerMetadata[layerManifestTypeKey],
+			data:      data,
+		})
+	}
+
+	if raw, ok := layerMetadata[layerConfigKey]; ok && raw != "" {
+		data := []byte(raw)
+		ic.manifests.putConfig(digest.FromBytes(data), blob{data: data})
+	}
+}
+
+func verifyBlobDigest(dgst digest.Digest, data []byte) error {
+	computed := digest.FromBytes(data)
+	if computed != dgst {
+		return fmt.Errorf("blob digest mismatch: expected %s, got %s", dgst, computed)
+	}
+	return nil
+}
+
+func (s *manifestStore) getManifest(dgst digest.Digest) (blob, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	b, ok := s.manifests[dgst]
+	return b, ok
+}
+
+func (s *manifestStore) putManifest(dgst digest.Digest, b blob) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.manifests[dgst] = b
+}
+
+func (s *manifestStore) getConfig(dgst digest.Digest) (blob, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	b, ok := s.configs[dgst]
+	return b, ok
+}
+
+func (s *manifestStore) putConfig(dgst digest.Digest, b blob) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.configs[dgst] = b
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/digest"
+)
+
+func TestHydrateManifestPopulatesStore(t *testing.T) {
+	ic := newICache()
+
+	manifestData := []byte(`{"schemaVersion":2}`)
+	configData := []byte(`{"os":"linux"}`)
+
+	ic.HydrateManifest(map[string]string{
+		layerManifestKey:     string(manifestData),
+		layerManifestTypeKey: MediaTypeDockerManifest,
+		layerConfigKey:       string(configData),
+	})
+
+	manifest, err := ic.GetManifest(digest.FromBytes(manifestData))
+	if err != nil {
+		t.Fatalf("GetManifest: %s", err)
+	}
+	if string(manifest) != string(manifestData) {
+		t.Errorf("GetManifest = %q, want %q", manifest, manifestData)
+	}
+
+	config, err := ic.GetConfig(digest.FromBytes(configData))
+	if err != nil {
+		t.Fatalf("GetConfig: %s", err)
+	}
+	if string(config) != string(configData) {
+		t.Errorf("GetConfig = %q, want %q", config, configData)
+	}
+}
+
+func TestHydrateManifestSkipsMissingKeys(t *testing.T) {
+	ic := newICache()
+
+	// a layer with no persisted manifest/config blobs (e.g. imported rather
+	// than pulled) must not cause HydrateManifest to error or panic.
+	ic.HydrateManifest(map[string]string{"metaData": "{}"})
+
+	if len(ic.manifests.manifests) != 0 || len(ic.manifests.configs) != 0 {
+		t.Error("HydrateManifest should not populate the store when no blobs are present")
+	}
+}
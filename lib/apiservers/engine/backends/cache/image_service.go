@@ -0,0 +1,153 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	derr "github.com/docker/docker/errors"
+
+	"github.com/vmware/vic/lib/apiservers/portlayer/client"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/storage"
+	"github.com/vmware/vic/lib/metadata"
+	"github.com/vmware/vic/pkg/vsphere/sys"
+)
+
+// ImageService is a partial step toward per-endpoint cache isolation: it
+// mirrors the Moby refactor that moved daemon image methods off of
+// package-level state and into a dedicated imageService, but today only the
+// image cache (ICache) is actually owned per instance. LayerCache() and
+// RepositoryCache() below are pass-throughs to the same process-wide
+// singletons every ImageService shares, so two ImageServices still see each
+// other's layers and repository tags. Do not rely on ImageService for
+// per-endpoint isolation until Isolated reports true -- TODO(jzt) give
+// LayerCache and RepositoryCache the same per-instance treatment as ICache.
+type ImageService struct {
+	ctx    context.Context
+	client *client.PortLayer
+	logger *log.Logger
+
+	images *ICache
+}
+
+// NewImageService constructs an ImageService backed by an empty image
+// cache. Call Update to hydrate it from the portlayer.
+func NewImageService(ctx context.Context, plClient *client.PortLayer, logger *log.Logger) *ImageService {
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+
+	return &ImageService{
+		ctx:    ctx,
+		client: plClient,
+		logger: logger,
+		images: newICache(),
+	}
+}
+
+// ICache returns the image metadata cache owned by this service.
+func (s *ImageService) ICache() *ICache {
+	return s.images
+}
+
+// LayerCache returns the layer cache backing this service.
+//
+// This is still the process-wide singleton; see the ImageService doc
+// comment and Isolated.
+func (s *ImageService) LayerCache() *LayerCache {
+	return LayerCache()
+}
+
+// RepositoryCache returns the repository (name/tag) cache backing this
+// service.
+//
+// This is still the process-wide singleton; see the ImageService doc
+// comment and Isolated.
+func (s *ImageService) RepositoryCache() *RepositoryCache {
+	return RepositoryCache()
+}
+
+// Isolated reports whether this service's caches are fully isolated from
+// every other ImageService in the process. It is false today because
+// LayerCache and RepositoryCache are still process-wide singletons; callers
+// that need real per-endpoint isolation (e.g. a test standing up two
+// ImageServices to assert they don't see each other's images) should check
+// this instead of assuming NewImageService delivers it.
+func (s *ImageService) Isolated() bool {
+	return false
+}
+
+// Update runs only once at startup to hydrate the service's image cache
+// from the portlayer, using the context and logger this service was
+// constructed with.
+func (s *ImageService) Update() error {
+	s.logger.Debug("Updating image cache")
+
+	host, err := sys.UUID()
+	if host == "" {
+		host, err = os.Hostname()
+	}
+	if err != nil {
+		return fmt.Errorf("Unexpected error getting hostname: %s", err)
+	}
+
+	params := storage.NewListImagesParamsWithContext(s.ctx).WithStoreName(host)
+
+	layers, err := s.client.Storage.ListImages(params)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve image list from portlayer: %s", err)
+	}
+
+	for _, layer := range layers.Payload {
+		// populate the layer cache as we go
+		// TODO(jzt): this will probably change once the k/v store is being used to track
+		// images (and layers?)
+		LayerCache().AddExisting(layer.ID)
+
+		s.images.HydrateManifest(layer.Metadata)
+
+		imageConfig := &metadata.ImageConfig{}
+		if err := json.Unmarshal([]byte(layer.Metadata[metadata.MetaDataKey]), imageConfig); err != nil {
+			s.logger.WithError(err).Error(derr.NewErrorWithStatusCode(
+				fmt.Errorf("Failed to unmarshal image config: %s", err), http.StatusInternalServerError))
+		}
+
+		if imageConfig.ImageID != "" {
+			s.images.AddImage(imageConfig)
+		}
+	}
+
+	return nil
+}
+
+// defaultService is the process-wide ImageService backing the ImageCache()
+// package function below, so call sites which haven't been migrated onto an
+// explicit *ImageService keep working unchanged.
+var defaultService = NewImageService(context.TODO(), nil, nil)
+
+// ImageCache returns the image cache owned by the default, process-wide
+// ImageService.
+//
+// Deprecated: construct an *ImageService with NewImageService and call
+// ICache() on it instead.
+func ImageCache() *ICache {
+	return defaultService.ICache()
+}
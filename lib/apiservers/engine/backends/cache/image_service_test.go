@@ -0,0 +1,47 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestImageServiceICacheIsOwnedPerInstance(t *testing.T) {
+	a := NewImageService(context.Background(), nil, nil)
+	b := NewImageService(context.Background(), nil, nil)
+
+	if a.ICache() == b.ICache() {
+		t.Error("two ImageServices should not share an ICache")
+	}
+}
+
+func TestImageServiceNotIsolated(t *testing.T) {
+	s := NewImageService(context.Background(), nil, nil)
+
+	// LayerCache and RepositoryCache are still process-wide singletons, so
+	// Isolated must report false until that migration lands -- see the
+	// ImageService doc comment.
+	if s.Isolated() {
+		t.Error("Isolated should be false until LayerCache/RepositoryCache are owned per instance")
+	}
+	if s.LayerCache() != LayerCache() {
+		t.Error("LayerCache should still be the process-wide singleton")
+	}
+	if s.RepositoryCache() != RepositoryCache() {
+		t.Error("RepositoryCache should still be the process-wide singleton")
+	}
+}
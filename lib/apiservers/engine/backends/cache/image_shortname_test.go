@@ -0,0 +1,71 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import "testing"
+
+func TestRepoHasShortName(t *testing.T) {
+	cases := []struct {
+		repo, shortName string
+		want            bool
+	}{
+		{"foo", "foo", true},
+		{"library/foo", "foo", true},
+		{"user/foo", "foo", true},
+		{"registry.example.com/library/foo", "foo", true},
+		{"myfoo", "foo", false},
+		{"foobar", "foo", false},
+		{"library/foobar", "foo", false},
+	}
+
+	for _, c := range cases {
+		if got := repoHasShortName(c.repo, c.shortName); got != c.want {
+			t.Errorf("repoHasShortName(%q, %q) = %v, want %v", c.repo, c.shortName, got, c.want)
+		}
+	}
+}
+
+func TestMatchingRepositories(t *testing.T) {
+	repos := []string{"library/foo", "user/foo", "myfoo", "foobar", "library/foo"}
+
+	got := matchingRepositories(repos, "foo")
+	want := []string{"library/foo", "user/foo"}
+
+	if len(got) != len(want) {
+		t.Fatalf("matchingRepositories returned %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("matchingRepositories returned %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMatchingRepositoriesNoCandidates(t *testing.T) {
+	repos := []string{"myfoo", "foobar"}
+
+	if got := matchingRepositories(repos, "foo"); len(got) != 0 {
+		t.Fatalf("matchingRepositories returned %v, want no matches", got)
+	}
+}
+
+func TestAmbiguousReferenceErrorMessage(t *testing.T) {
+	err := &AmbiguousReferenceError{Name: "foo", Candidates: []string{"library/foo", "user/foo"}}
+
+	const want = `short name "foo" is ambiguous: candidates are library/foo, user/foo`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}